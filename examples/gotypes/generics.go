@@ -0,0 +1,102 @@
+package gotypes
+
+import (
+	"bytes"
+	"go/ast"
+	"go/format"
+	"go/parser"
+	"go/token"
+	"regexp"
+)
+
+// genericsFraction is roughly how often maybeInjectGenerics mutates an
+// input: 1 in genericsFraction, so a meaningful share of fuzz iterations
+// exercise instantiation/inference without every run paying the extra
+// parse/render cost.
+const genericsFraction = 4
+
+// maybeInjectGenerics parses data and, for about one in genericsFraction
+// inputs, adds a type parameter list to the first eligible function or
+// type declaration so the differential oracles also see type-parameterized
+// code, which this package's oracle could not check while it was built on
+// golang.org/x/tools/go/types (from before Go 1.18). If data doesn't parse
+// or has nothing eligible, it's returned unchanged.
+func maybeInjectGenerics(data []byte) []byte {
+	if len(data) == 0 || int(data[0])%genericsFraction != 0 {
+		return data
+	}
+	fset := token.NewFileSet()
+	f, err := parser.ParseFile(fset, "src.go", data, parser.ParseComments)
+	if err != nil {
+		return data
+	}
+	if !injectTypeParams(f, int(data[0])) {
+		return data
+	}
+	var buf bytes.Buffer
+	if err := format.Node(&buf, fset, f); err != nil {
+		return data
+	}
+	return buf.Bytes()
+}
+
+// injectTypeParams adds a single type parameter "T" to the first FuncDecl
+// or type declaration that doesn't already have one (methods are skipped),
+// cycling between any,
+// comparable and a small union-constraint interface based on seed so
+// repeated runs cover all three shapes.
+func injectTypeParams(f *ast.File, seed int) bool {
+	constraints := []ast.Expr{
+		ast.NewIdent("any"),
+		ast.NewIdent("comparable"),
+		&ast.InterfaceType{Methods: &ast.FieldList{
+			List: []*ast.Field{{
+				Type: &ast.BinaryExpr{X: ast.NewIdent("int"), Op: token.OR, Y: ast.NewIdent("int64")},
+			}},
+		}},
+	}
+	typeParams := &ast.FieldList{
+		List: []*ast.Field{{
+			Names: []*ast.Ident{ast.NewIdent("T")},
+			Type:  constraints[seed%len(constraints)],
+		}},
+	}
+
+	for _, decl := range f.Decls {
+		switch d := decl.(type) {
+		case *ast.FuncDecl:
+			if d.Recv != nil || d.Type.TypeParams != nil {
+				continue
+			}
+			d.Type.TypeParams = typeParams
+			return true
+		case *ast.GenDecl:
+			if d.Tok != token.TYPE {
+				continue
+			}
+			for _, spec := range d.Specs {
+				ts, ok := spec.(*ast.TypeSpec)
+				if !ok || ts.TypeParams != nil {
+					continue
+				}
+				ts.TypeParams = typeParams
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// typeParamPattern matches the type parameter lists injectTypeParams
+// writes ("[T any]", "[T comparable]", "[T interface{ ... }]"), and
+// incidentally any naturally-fuzzed generic code shaped the same way.
+var typeParamPattern = regexp.MustCompile(`\[[A-Za-z_]\w*\s+(any|comparable|interface\b)`)
+
+// hasTypeParams reports whether data contains a type parameter list.
+// gccgo is a pre-1.18 frontend that rejects this syntax unconditionally,
+// so its "error" on such input carries no signal and callers should leave
+// it out of any oracle vote rather than let a guaranteed rejection look
+// like a discrepancy.
+func hasTypeParams(data []byte) bool {
+	return typeParamPattern.Match(data)
+}
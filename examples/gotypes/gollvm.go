@@ -0,0 +1,69 @@
+package gotypes
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"os/exec"
+)
+
+// gollvmPathEnvVar points at the llvm-goc/llgo binary driving the gollvm
+// oracle below. Unset (the common case on a machine without gollvm built)
+// falls back to defaultGollvmPath, and the oracle is skipped entirely if that
+// can't be found on PATH either.
+const gollvmPathEnvVar = "GOFUZZ_GOLLVM_PATH"
+
+const defaultGollvmPath = "llvm-goc"
+
+func gollvmPath() string {
+	if p := os.Getenv(gollvmPathEnvVar); p != "" {
+		return p
+	}
+	return defaultGollvmPath
+}
+
+// gollvmAvailable reports whether the gollvm oracle can run at all; callers
+// should skip voting it in rather than treat "binary missing" as a reject.
+func gollvmAvailable() bool {
+	_, err := exec.LookPath(gollvmPath())
+	return err == nil
+}
+
+// gollvm compiles data with the gollvm/LLVM-based Go frontend, the third
+// leg of the differential oracle alongside gc and gccgo.
+func gollvm(data []byte) error {
+	cmd := exec.Command(gollvmPath(), "-c", "-x", "go", "-o", os.DevNull, "-")
+	cmd.Stdin = bytes.NewReader(data)
+	out, err := cmd.CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("%s\n%s", out, err)
+	}
+	return nil
+}
+
+// voteDiscrepancy runs an N-way accept/reject vote across votes (oracle
+// name -> error, nil meaning the oracle accepted the input). It returns
+// the names on the minority side when there is one (e.g. two oracles
+// accept and one rejects), or tie=true when the vote is evenly split and
+// no side can be singled out as the suspected bug. A unanimous vote
+// (everyone accepts or everyone rejects) reports no discrepancy at all.
+func voteDiscrepancy(votes map[string]error) (minority []string, tie bool) {
+	var accept, reject []string
+	for name, err := range votes {
+		if err == nil {
+			accept = append(accept, name)
+		} else {
+			reject = append(reject, name)
+		}
+	}
+	if len(accept) == 0 || len(reject) == 0 {
+		return nil, false
+	}
+	if len(accept) < len(reject) {
+		return accept, false
+	}
+	if len(reject) < len(accept) {
+		return reject, false
+	}
+	return nil, true
+}
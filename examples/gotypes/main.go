@@ -5,17 +5,17 @@ import (
 	"fmt"
 	"go/ast"
 	"go/format"
+	"go/importer"
 	"go/parser"
 	"go/token"
+	"go/types"
 	"io/ioutil"
 	"os"
 	"os/exec"
 	"regexp"
-	"strings"
+	"sort"
 
-	_ "golang.org/x/tools/go/gcimporter"
 	"golang.org/x/tools/go/ssa"
-	"golang.org/x/tools/go/types"
 )
 
 // https://github.com/golang/go/issues/11327
@@ -25,11 +25,11 @@ var bigNum = regexp.MustCompile("(\\.[0-9]*)|([0-9]+)[eE]\\-?\\+?[0-9]{3,}")
 var formatBug1 = regexp.MustCompile("\\*/[ \t\n\r\f\v]*;")
 var formatBug2 = regexp.MustCompile(";[ \t\n\r\f\v]*/\\*")
 
-var issue11528 = regexp.MustCompile("/\\*(.*\n)+.*\\*/")
-var issue11533 = regexp.MustCompile("[ \r\t\n=\\+\\-\\*\\^\\/\\(,]0[0-9]+[ieE]")
 var issue11531 = regexp.MustCompile(",[ \t\r\n]*,")
 
-var fpRounding = regexp.MustCompile(" \\(untyped float constant .*\\) truncated to ")
+// The rest of the known-issue substring/regexp filters that used to live
+// here as a strings.Contains cascade now live in rules.json, loaded by
+// rules.go into the Rule registry and applied via suppress().
 
 var gcCrash = regexp.MustCompile("\n/tmp/fuzz\\.gc[0-9]+:[0-9]+: internal compiler error: ")
 var gccgoCrash = regexp.MustCompile("\ngo1: internal compiler error:")
@@ -44,251 +44,115 @@ func Fuzz(data []byte) int {
 		// https://github.com/golang/go/issues/11531
 		return 0
 	}
+	data = maybeInjectGenerics(data)
 	goErr := gotypes(data)
+	if sbErr, ok := goErr.(*ssaBuilderError); ok {
+		fmt.Printf("go/types result: %v\n", sbErr)
+		reportDiscrepancy("ssa-builder-bug", data, func(d []byte) bool {
+			_, ok := gotypes(d).(*ssaBuilderError)
+			return ok
+		})
+		panic(sbErr.Error())
+	}
 	//gcErr := gc(data)
 	gcErr := goErr
 	gccgoErr := gccgo(data)
-	if goErr == nil && gcErr != nil && strings.Contains(gcErr.Error(), "line number out of range") {
-		// https://github.com/golang/go/issues/11329
-		return 0
-	}
-	if goErr == nil && gcErr != nil && strings.Contains(gcErr.Error(), "stupid shift:") {
-		// https://github.com/golang/go/issues/11328
-		return 0
-	}
-	if gcErr == nil && goErr != nil && strings.Contains(goErr.Error(), "untyped float constant") {
-		// https://github.com/golang/go/issues/11350
-		return 0
-	}
-	if goErr == nil && gcErr != nil && strings.Contains(gcErr.Error(), "overflow in int -> string") {
-		// https://github.com/golang/go/issues/11330
-		return 0
-	}
-	if gcErr == nil && goErr != nil && strings.Contains(goErr.Error(), "illegal character U+") {
-		// https://github.com/golang/go/issues/11359
-		return 0
-	}
-	if goErr == nil && gcErr != nil && strings.Contains(gcErr.Error(), "larger than address space") {
-		// Gc is more picky at rejecting huge objects.
-		return 0
-	}
-	if goErr == nil && gcErr != nil && strings.Contains(gcErr.Error(), "non-canonical import path") {
-		return 0
-	}
+	errs := map[string]error{"go": goErr, "gc": gcErr, "gccgo": gccgoErr}
 
-	if gccgoErr == nil && goErr != nil {
-		if strings.Contains(goErr.Error(), "invalid operation: stupid shift count") {
-			// https://github.com/golang/go/issues/11524
-			return 0
-		}
-		if (bytes.Contains(data, []byte("//line")) || bytes.Contains(data, []byte("/*"))) &&
-			(strings.Contains(goErr.Error(), "illegal UTF-8 encoding") ||
-				strings.Contains(goErr.Error(), "illegal character NUL")) {
-			// https://github.com/golang/go/issues/11527
-			return 0
-		}
-		if strings.Contains(goErr.Error(), "invalid operation: operator ^ not defined for") {
-			// https://github.com/golang/go/issues/11529
-			return 0
-		}
-		if fpRounding.MatchString(goErr.Error()) {
-			// gccgo has different rounding
-			return 0
-		}
-		if bytes.Contains(data, []byte("_")) &&
-			(strings.Contains(goErr.Error(), ": undeclared name: ") || strings.Contains(goErr.Error(), "invalid array length")) {
-			// https://github.com/golang/go/issues/11547
-			// https://github.com/golang/go/issues/11535
-			return 0
-		}
-		if strings.Contains(goErr.Error(), "not enough arguments for complex") {
-			// https://github.com/golang/go/issues/11561
-			return 0
-		}
-		if strings.Contains(goErr.Error(), "operator | not defined for") {
-			// https://github.com/golang/go/issues/11566
-			return 0
-		}
-		if strings.Contains(goErr.Error(), "nil (untyped nil value) is not a type") {
-			// https://github.com/golang/go/issues/11567
-			return 0
-		}
-		if strings.Contains(goErr.Error(), "(built-in) must be called") {
-			// https://github.com/golang/go/issues/11570
-			return 0
-		}
-		if strings.Contains(goErr.Error(), "redeclared in this block") {
-			// https://github.com/golang/go/issues/11573
-			return 0
-		}
-		if strings.Contains(goErr.Error(), "illegal byte order mark") {
-			// on "package\rG\n//line \ufeff:1" input, not filed.
-			return 0
-		}
-		if strings.Contains(goErr.Error(), "unknown escape sequence") {
-			// https://github.com/golang/go/issues/11575
-			return 0
-		}
-	}
-
-	if goErr == nil && gccgoErr != nil {
-		if strings.Contains(gccgoErr.Error(), "error: string index out of bounds") {
-			// https://github.com/golang/go/issues/11522
-			return 0
-		}
-		if strings.Contains(gccgoErr.Error(), "error: integer constant overflow") {
-			// https://github.com/golang/go/issues/11525
-			return 0
-		}
-		if issue11533.Match(data) {
-			// https://github.com/golang/go/issues/11532
-			// https://github.com/golang/go/issues/11533
-			return 0
-		}
-		if bytes.Contains(data, []byte("0i")) &&
-			(strings.Contains(gccgoErr.Error(), "incompatible types in binary expression") ||
-				strings.Contains(gccgoErr.Error(), "initialization expression has wrong type")) {
-			// https://github.com/golang/go/issues/11564
-			// https://github.com/golang/go/issues/11563
-			return 0
-		}
-		if strings.Contains(gccgoErr.Error(), "invalid character 0x37f in input file") {
-			// https://github.com/golang/go/issues/11569
-			return 0
-		}
-		if strings.Contains(gccgoErr.Error(), "error: incompatible types in binary expression") {
-			// https://github.com/golang/go/issues/11572
-			return 0
-		}
-	}
-
-	if goErr == nil && gccgoErr != nil && strings.Contains(gccgoErr.Error(), ": error: import file ") {
-		// Temporal workaround for broken gccgo installation.
-		// Remove this.
-		return 0
-	}
-
-	if (goErr == nil && gccgoErr != nil || goErr != nil && gccgoErr == nil) && issue11528.Match(data) {
-		// https://github.com/golang/go/issues/11528
+	if suppress(data, errs, "") {
 		return 0
 	}
 
 	// go-fuzz is too smart so it can generate a program that contains "internal compiler error" in an error message :)
 	if gcErr != nil && gcCrash.MatchString(gcErr.Error()) {
-		if strings.Contains(gcErr.Error(), "internal compiler error: out of fixed registers") {
-			// https://github.com/golang/go/issues/11352
-			return 0
-		}
-		if strings.Contains(gcErr.Error(), "internal compiler error: naddr: bad HMUL") {
-			// https://github.com/golang/go/issues/11358
-			return 0
-		}
-		if strings.Contains(gcErr.Error(), "internal compiler error: treecopy Name") {
-			// https://github.com/golang/go/issues/11361
+		if suppress(data, map[string]error{"gc": gcErr}, crashClassGC) {
 			return 0
 		}
 		fmt.Printf("gc result: %v\n", gcErr)
+		reportDiscrepancy("gc-crash", data, func(d []byte) bool {
+			e := gotypes(d)
+			return e != nil && gcCrash.MatchString(e.Error())
+		})
 		panic("gc compiler crashed")
 	}
 
 	if gccgoErr != nil && gccgoCrash.MatchString(gccgoErr.Error()) {
-		if strings.Contains(gccgoErr.Error(), "warning: no arguments for builtin function ‘print’") {
-			// https://github.com/golang/go/issues/11526
-			return 0
-		}
-		if strings.Contains(gccgoErr.Error(), "error: constant refers to itself") {
-			// https://github.com/golang/go/issues/11536
-			return 0
-		}
-		if strings.Contains(gccgoErr.Error(), "go1: internal compiler error: in set_type, at go/gofrontend/expressions.cc") {
-			// https://github.com/golang/go/issues/11537
-			return 0
-		}
-		if strings.Contains(gccgoErr.Error(), "go1: internal compiler error: in global_variable_set_init, at go/go-gcc.cc") {
-			// https://github.com/golang/go/issues/11541
-			return 0
-		}
-		if strings.Contains(gccgoErr.Error(), "go1: internal compiler error: in wide_int_to_tree, at tree.c") {
-			// https://github.com/golang/go/issues/11542
-			return 0
-		}
-		if strings.Contains(gccgoErr.Error(), "go1: internal compiler error: in record_var_depends_on, at go/gofrontend/gogo.h") {
-			// https://github.com/golang/go/issues/11543
-			return 0
-		}
-		if strings.Contains(gccgoErr.Error(), "go1: internal compiler error: in Builtin_call_expression, at go/gofrontend/expressions.cc") {
-			// https://github.com/golang/go/issues/11544
-			return 0
-		}
-		if strings.Contains(gccgoErr.Error(), "go1: internal compiler error: in check_bounds, at go/gofrontend/expressions.cc") {
-			// https://github.com/golang/go/issues/11545
-			return 0
-		}
-		if strings.Contains(gccgoErr.Error(), "go1: internal compiler error: in do_determine_type, at go/gofrontend/expressions.h") {
-			// https://github.com/golang/go/issues/11546
-			return 0
-		}
-		if strings.Contains(gccgoErr.Error(), "go1: internal compiler error: in backend_numeric_constant_expression, at go/gofrontend/expressions.cc") {
-			// https://github.com/golang/go/issues/11548
-			return 0
-		}
-		if strings.Contains(gccgoErr.Error(), "go1: internal compiler error: in declare_function, at go/gofrontend/gogo.cc") {
-			// https://github.com/golang/go/issues/11557
-			return 0
-		}
-		if strings.Contains(gccgoErr.Error(), "gcc/go/gofrontend/expressions.cc:5756") {
-			// https://github.com/golang/go/issues/11558
-			return 0
-		}
-		if strings.Contains(gccgoErr.Error(), "Send_statement::do_flatten") {
-			// https://github.com/golang/go/issues/11559
-			return 0
-		}
-		if strings.Contains(gccgoErr.Error(), "internal compiler error: in do_get_backend, at go/gofrontend/expressions.cc") {
-			// https://github.com/golang/go/issues/11560
-			return 0
-		}
-		if strings.Contains(gccgoErr.Error(), "go1: internal compiler error: in type_size, at go/go-gcc.cc") {
-			// https://github.com/golang/go/issues/11554
-			// https://github.com/golang/go/issues/11555
-			// https://github.com/golang/go/issues/11556
-			return 0
-		}
-		if strings.Contains(gccgoErr.Error(), "go1: internal compiler error: in create_tmp_var, at gimple-expr.c") {
-			// https://github.com/golang/go/issues/11568
-			return 0
-		}
-		if strings.Contains(gccgoErr.Error(), "go1: internal compiler error: in start_function, at go/gofrontend/gogo.cc") {
-			// https://github.com/golang/go/issues/11576
-			return 0
-		}
-		if strings.Contains(gccgoErr.Error(), "go1: internal compiler error: in methods, at go/gofrontend/types.cc") {
-			// https://github.com/golang/go/issues/11579
+		if suppress(data, map[string]error{"gccgo": gccgoErr}, crashClassGccgo) {
 			return 0
 		}
 		fmt.Printf("gccgo result: %v\n", gccgoErr)
+		reportDiscrepancy("gccgo-crash", data, func(d []byte) bool {
+			e := gccgo(d)
+			return e != nil && gccgoCrash.MatchString(e.Error())
+		})
 		panic("gccgo compiler crashed")
 	}
 
 	if gccgoErr != nil && asanCrash.MatchString(gccgoErr.Error()) {
-		if strings.Contains(gccgoErr.Error(), " in Lex::skip_cpp_comment() ../../gcc/go/gofrontend/lex.cc") {
-			// https://github.com/golang/go/issues/11577
+		if suppress(data, map[string]error{"gccgo": gccgoErr}, crashClassGccgoAsan) {
 			return 0
 		}
 		fmt.Printf("gccgo result: %v\n", gccgoErr)
+		reportDiscrepancy("gccgo-asan-crash", data, func(d []byte) bool {
+			e := gccgo(d)
+			return e != nil && asanCrash.MatchString(e.Error())
+		})
 		panic("gccgo compiler crashed")
 	}
 
-	if (goErr == nil) != (gcErr == nil) || (goErr == nil) != (gccgoErr == nil) {
-		fmt.Printf("go/types result: %v\n", goErr)
-		fmt.Printf("gc result: %v\n", gcErr)
-		fmt.Printf("gccgo result: %v\n", gccgoErr)
-		panic("gc, gccgo and go/types disagree")
+	// gc itself is omitted from the vote below: gcErr is currently just an
+	// alias for goErr (see the commented-out gc(data) call above), so it
+	// never contributes independent information to the vote.
+	votes := map[string]error{"go": goErr}
+	if !hasTypeParams(data) {
+		// gccgo predates Go 1.18 and rejects any type parameter list
+		// outright; counting that guaranteed rejection as a vote would
+		// make every generics-injected input a false-positive "disagree".
+		votes["gccgo"] = gccgoErr
+	}
+	if gollvmAvailable() {
+		votes["gollvm"] = gollvm(data)
+	}
+	if minority, tie := voteDiscrepancy(votes); len(minority) > 0 || tie {
+		for name, err := range votes {
+			fmt.Printf("%s result: %v\n", name, err)
+		}
+		reportDiscrepancy("oracle-vote-disagree", data, func(d []byte) bool {
+			v := map[string]error{"go": gotypes(d)}
+			if !hasTypeParams(d) {
+				v["gccgo"] = gccgo(d)
+			}
+			if gollvmAvailable() {
+				v["gollvm"] = gollvm(d)
+			}
+			m, t := voteDiscrepancy(v)
+			return len(m) > 0 || t
+		})
+		if tie {
+			names := make([]string, 0, len(votes))
+			for name := range votes {
+				names = append(names, name)
+			}
+			sort.Strings(names)
+			panic(fmt.Sprintf("oracles tied and disagree: %v", names))
+		}
+		panic(fmt.Sprintf("oracles disagree, suspect: %v", minority))
 	}
 	if goErr != nil {
 		return 0
 
 	}
+
+	if multiErrs := gcMulti(data); archDivergence(data, multiErrs) {
+		for t, err := range multiErrs {
+			fmt.Printf("gc %s result: %v\n", t, err)
+		}
+		reportDiscrepancy("gc-arch-divergence", data, func(d []byte) bool {
+			return archDivergence(d, gcMulti(d))
+		})
+		panic("gc disagrees across GOOS/GOARCH targets")
+	}
+
 	if formatBug1.Match(data) || formatBug2.Match(data) {
 		return 1
 	}
@@ -319,24 +183,54 @@ func gotypes(data []byte) (err error) {
 	// provide error handler
 	// initialize maps in config
 	conf := &types.Config{
-		Error: func(err error) {},
-		Sizes: &types.StdSizes{4, 8},
+		Error:    func(err error) {},
+		Sizes:    &types.StdSizes{4, 8},
+		Importer: importer.Default(),
 	}
-	_, err = conf.Check("pkg", fset, []*ast.File{f}, nil)
+	info := &types.Info{
+		Types:      make(map[ast.Expr]types.TypeAndValue),
+		Defs:       make(map[*ast.Ident]types.Object),
+		Uses:       make(map[*ast.Ident]types.Object),
+		Implicits:  make(map[ast.Node]types.Object),
+		Selections: make(map[*ast.SelectorExpr]*types.Selection),
+		Scopes:     make(map[ast.Node]*types.Scope),
+	}
+	var pkg *types.Package
+	pkg, err = conf.Check("pkg", fset, []*ast.File{f}, info)
 	if err != nil {
 		return
 	}
-	prog := ssa.NewProgram(fset, ssa.BuildSerially|ssa.SanityCheckFunctions|ssa.GlobalDebug)
-	prog.BuildAll()
-	for _, pkg := range prog.AllPackages() {
-		_, err := pkg.WriteTo(ioutil.Discard)
-		if err != nil {
-			panic(err)
-		}
+
+	// Build twice under different builder modes and diff the result: the
+	// SSA builder is supposed to be deterministic, so any difference here
+	// is a builder bug, not a bug in the fuzzed program. Report it as an
+	// *ssaBuilderError rather than panicking here directly, so callers
+	// (Fuzz, and the discriminator closures Minimize drives) can tell a
+	// builder bug apart from an ordinary type-check error and route it
+	// through the same minimize/dedup/crash-dir pipeline as every other
+	// discrepancy instead of panicking on raw, unminimized input.
+	serial := buildSSA(fset, f, pkg, info, ssa.BuildSerially)
+	parallel := buildSSA(fset, f, pkg, info, 0)
+	if diff := diffSSA(serial, parallel); diff != "" {
+		return &ssaBuilderError{"ssa builder nondeterministic: " + diff}
+	}
+
+	if rtErr := verifySSARoundTrip(fset, f, pkg, info, serial); rtErr != nil {
+		return &ssaBuilderError{"ssa sanity check failed: " + rtErr.Error()}
 	}
-	return
+	return nil
 }
 
+// ssaBuilderError distinguishes a bug in the SSA builder itself (detected
+// by diffSSA or verifySSARoundTrip) from an ordinary type-check error, so
+// Fuzz can report and minimize it as its own crash class instead of
+// silently treating the input as merely ill-typed.
+type ssaBuilderError struct {
+	msg string
+}
+
+func (e *ssaBuilderError) Error() string { return e.msg }
+
 func gc(data []byte) error {
 	f, err := ioutil.TempFile("", "fuzz.gc")
 	if err != nil {
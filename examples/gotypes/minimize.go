@@ -0,0 +1,244 @@
+package gotypes
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"go/ast"
+	"go/format"
+	"go/parser"
+	"go/token"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+)
+
+// crashDirEnvVar lets a fuzzing run redirect where minimized discrepancies
+// get written, e.g. into the corpus directory go-fuzz already watches.
+const crashDirEnvVar = "GOFUZZ_CRASH_DIR"
+
+const defaultCrashDir = "crashers"
+
+// Minimize shrinks data while discriminator(data) keeps reporting the same
+// discrepancy, so a multi-hundred-byte crasher collapses to the handful of
+// tokens that actually trigger it. It runs three passes: a ddmin-style
+// chunk deletion at exponentially decreasing granularity, an AST-aware pass
+// that drops whole declarations/statements or replaces expressions with
+// nil, and a final byte-level ddmin pass to mop up whatever the AST pass
+// couldn't touch (e.g. inputs that don't parse).
+//
+// discriminator is called many times over the course of minimizing, on
+// candidates that are by construction mangled and untested; a discriminator
+// built on top of oracles that themselves can panic (e.g. gotypes, whose
+// SSA builder panics on a failed sanity check)
+// must not be allowed to take the whole minimization run down with it, so
+// every call goes through a recover() wrapper that treats a panicking
+// trial as simply "doesn't reproduce".
+func Minimize(data []byte, discriminator func([]byte) bool) []byte {
+	test := recoverDiscriminator(discriminator)
+	if !test(data) {
+		// Not reproducible from the start; nothing sound to shrink.
+		return data
+	}
+	data = ddmin(data, test)
+	data = astPrune(data, test)
+	data = ddmin(data, test)
+	return data
+}
+
+// recoverDiscriminator wraps discriminator so a panic on some mangled
+// candidate is reported as "doesn't reproduce" instead of escaping and
+// crashing the minimizer in place of the discrepancy it was trying to
+// shrink.
+func recoverDiscriminator(discriminator func([]byte) bool) func([]byte) bool {
+	return func(d []byte) (reproduced bool) {
+		defer func() {
+			if recover() != nil {
+				reproduced = false
+			}
+		}()
+		return discriminator(d)
+	}
+}
+
+// ddmin is the classic delta-debugging chunk-deletion loop: try removing
+// ever-smaller contiguous chunks, halving the chunk size whenever no chunk
+// can be removed. After a successful removal the scan restarts from the
+// start of the data at one step coarser granularity (n-1, never below 2).
+func ddmin(data []byte, test func([]byte) bool) []byte {
+	n := 2
+	for len(data) > 1 {
+		chunkSize := (len(data) + n - 1) / n
+		if chunkSize == 0 {
+			break
+		}
+		removed := false
+		for start := 0; start < len(data); start += chunkSize {
+			end := start + chunkSize
+			if end > len(data) {
+				end = len(data)
+			}
+			trial := cut(data, start, end)
+			if len(trial) < len(data) && test(trial) {
+				data = trial
+				if n > 2 {
+					n--
+				}
+				removed = true
+				break
+			}
+		}
+		if !removed {
+			if n >= len(data) {
+				break
+			}
+			n *= 2
+		}
+	}
+	return data
+}
+
+func cut(data []byte, start, end int) []byte {
+	out := make([]byte, 0, len(data)-(end-start))
+	out = append(out, data[:start]...)
+	out = append(out, data[end:]...)
+	return out
+}
+
+func replace(data []byte, start, end int, repl string) []byte {
+	out := make([]byte, 0, len(data)-(end-start)+len(repl))
+	out = append(out, data[:start]...)
+	out = append(out, repl...)
+	out = append(out, data[end:]...)
+	return out
+}
+
+// astPrune repeatedly parses data and tries dropping a whole declaration or
+// statement, or replacing an expression with "nil", keeping the change only
+// if the discrepancy still reproduces. It gives up (returning data as-is)
+// the moment data no longer parses as a *ast.File, since its edits rely on
+// the AST having node positions that line up with the source bytes.
+func astPrune(data []byte, test func([]byte) bool) []byte {
+	for {
+		fset := token.NewFileSet()
+		f, err := parser.ParseFile(fset, "src.go", data, parser.ParseComments)
+		if err != nil {
+			return data
+		}
+		next, ok := prunePass(fset, f, data, test)
+		if !ok {
+			return data
+		}
+		data = next
+	}
+}
+
+type editCandidate struct {
+	start, end int
+	repl       string
+}
+
+func prunePass(fset *token.FileSet, f *ast.File, data []byte, test func([]byte) bool) ([]byte, bool) {
+	var candidates []editCandidate
+	for _, d := range f.Decls {
+		candidates = append(candidates, span(fset, d, ""))
+	}
+	ast.Inspect(f, func(n ast.Node) bool {
+		switch v := n.(type) {
+		case *ast.BlockStmt:
+			for _, stmt := range v.List {
+				candidates = append(candidates, span(fset, stmt, ""))
+			}
+		case ast.Expr:
+			switch v.(type) {
+			case *ast.Ident, *ast.BasicLit:
+				// Already minimal; replacing "nil" with "nil" wastes a step.
+			default:
+				candidates = append(candidates, span(fset, v, "nil"))
+			}
+		}
+		return true
+	})
+
+	// Try the biggest spans first: a single removal that subsumes several
+	// smaller candidates collapses the source faster.
+	sort.Slice(candidates, func(i, j int) bool {
+		return (candidates[i].end - candidates[i].start) > (candidates[j].end - candidates[j].start)
+	})
+
+	for _, c := range candidates {
+		if c.start < 0 || c.end > len(data) || c.start >= c.end {
+			continue
+		}
+		var trial []byte
+		if c.repl == "" {
+			trial = cut(data, c.start, c.end)
+		} else {
+			trial = replace(data, c.start, c.end, c.repl)
+		}
+		if len(trial) < len(data) && test(trial) {
+			return trial, true
+		}
+	}
+	return nil, false
+}
+
+func span(fset *token.FileSet, n ast.Node, repl string) editCandidate {
+	return editCandidate{
+		start: fset.Position(n.Pos()).Offset,
+		end:   fset.Position(n.End()).Offset,
+		repl:  repl,
+	}
+}
+
+var (
+	seenMu  sync.Mutex
+	seenSig = map[string]bool{}
+)
+
+// signature normalizes data (gofmt, falling back to the raw bytes if it
+// doesn't parse) and hashes it, so two minimized crashers that differ only
+// in formatting are recognized as the same underlying bug.
+func signature(data []byte) string {
+	if out, err := format.Source(data); err == nil {
+		data = out
+	}
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// reportDiscrepancy minimizes data against discriminator and writes both
+// the original and minimized form under the directory named by
+// $GOFUZZ_CRASH_DIR (defaultCrashDir when unset), skipping inputs whose
+// minimized signature was already seen this session so the same bug isn't
+// filed once per fuzzing iteration.
+func reportDiscrepancy(class string, data []byte, discriminator func([]byte) bool) {
+	minimized := Minimize(data, discriminator)
+	sig := signature(minimized)
+
+	seenMu.Lock()
+	dup := seenSig[sig]
+	seenSig[sig] = true
+	seenMu.Unlock()
+	if dup {
+		return
+	}
+
+	dir := os.Getenv(crashDirEnvVar)
+	if dir == "" {
+		dir = defaultCrashDir
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		fmt.Printf("minimize: could not create %s: %v\n", dir, err)
+		return
+	}
+	base := filepath.Join(dir, class+"-"+sig[:16])
+	if err := ioutil.WriteFile(base+".orig", data, 0644); err != nil {
+		fmt.Printf("minimize: %v\n", err)
+	}
+	if err := ioutil.WriteFile(base+".min", minimized, 0644); err != nil {
+		fmt.Printf("minimize: %v\n", err)
+	}
+}
@@ -0,0 +1,88 @@
+package gotypes
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+)
+
+// triple is a GOOS/GOARCH pair the gc backend is cross-compiled for in
+// gcMulti.
+type triple struct {
+	goos   string
+	goarch string
+}
+
+func (t triple) String() string {
+	return t.goos + "/" + t.goarch
+}
+
+// targetTriples mirrors the set of arch-specific defaults the gc toolchain
+// itself carries (e.g. defaultGOMIPS64=hardfloat) and that have historically
+// shipped arch-specific ICEs.
+var targetTriples = []triple{
+	{"linux", "amd64"},
+	{"linux", "386"},
+	{"linux", "arm"},
+	{"linux", "arm64"},
+	{"linux", "mips64"},
+	{"linux", "riscv64"},
+	{"darwin", "amd64"},
+	{"windows", "amd64"},
+}
+
+// gcMulti compiles data with "go tool compile" once per entry in
+// targetTriples and returns the result keyed by "GOOS/GOARCH", with a nil
+// entry for every triple that compiled. Fuzz calls it only for input that
+// go/types already accepted, so a triple that fails to compile it (an ICE,
+// typically) while others accept it is a bug worth reporting.
+func gcMulti(data []byte) map[string]error {
+	results := make(map[string]error, len(targetTriples))
+
+	f, err := ioutil.TempFile("", "fuzz.gcmulti")
+	if err != nil {
+		for _, t := range targetTriples {
+			results[t.String()] = err
+		}
+		return results
+	}
+	defer os.Remove(f.Name())
+	defer f.Close()
+	if _, err := f.Write(data); err != nil {
+		for _, t := range targetTriples {
+			results[t.String()] = err
+		}
+		return results
+	}
+	f.Close()
+
+	for _, t := range targetTriples {
+		cmd := exec.Command("go", "tool", "compile", "-p", "pkg", "-o", os.DevNull, f.Name())
+		cmd.Env = append(os.Environ(), "GOOS="+t.goos, "GOARCH="+t.goarch)
+		out, err := cmd.CombinedOutput()
+		if err != nil {
+			results[t.String()] = fmt.Errorf("%s\n%s", out, err)
+		} else {
+			results[t.String()] = nil
+		}
+	}
+	return results
+}
+
+// archDivergence reports whether the triples in results disagree on whether
+// data compiles, restricted to the triples not already excused by a rule.
+func archDivergence(data []byte, results map[string]error) bool {
+	var sawOK, sawErr bool
+	for triple, err := range results {
+		if suppress(data, map[string]error{triple: err}, "") {
+			continue
+		}
+		if err == nil {
+			sawOK = true
+		} else {
+			sawErr = true
+		}
+	}
+	return sawOK && sawErr
+}
@@ -0,0 +1,217 @@
+package gotypes
+
+import (
+	_ "embed"
+	"encoding/json"
+	"os"
+	"regexp"
+	"strings"
+	"sync/atomic"
+)
+
+// rulesEnvVar lets a fuzzing run point at an alternate rule file without
+// rebuilding the binary, e.g. to try a trimmed-down set during triage.
+const rulesEnvVar = "GOFUZZ_RULES_FILE"
+
+// Crash classes a Rule.CrashClass can name, one per crash block in Fuzz.
+const (
+	crashClassGC        = "gc-crash"
+	crashClassGccgo     = "gccgo-crash"
+	crashClassGccgoAsan = "gccgo-asan-crash"
+)
+
+// defaultRules is rules.json embedded at build time rather than read from
+// a relative path at runtime: go-fuzz runs the built fuzz binary from its
+// own workdir, not from this package's directory, so a bare "rules.json"
+// resolved against the process CWD would silently fail to load and every
+// known-issue rule would be inactive in the one deployment this registry
+// is actually for.
+//
+//go:embed rules.json
+var defaultRules []byte
+
+// Rule describes a single known-issue filter: a discrepancy between backends
+// that is expected until some upstream issue is fixed, expressed as data
+// instead of as a strings.Contains chain buried in Fuzz.
+//
+// Backends names which error(s) ErrorSubstring/ErrorRegexp are matched
+// against: "go" (go/types), "gc", "gccgo". Condition is an optional small
+// boolean expression gating the rule on the nil-ness of those same errors,
+// e.g. "go==nil && gc!=nil" or "disagree(go,gccgo)". Triples is the
+// gcMulti equivalent of Backends: it names GOOS/GOARCH triples (e.g.
+// "linux/mips64") instead of compiler backends, for rules that only
+// suppress a discrepancy on specific targets.
+type Rule struct {
+	Name       string   `json:"name"`
+	Issue      string   `json:"issue"`
+	Backends   []string `json:"backends"`
+	Triples    []string `json:"triples"`
+	ErrSubstr  string   `json:"error_substring"`
+	ErrRegexp  string   `json:"error_regexp"`
+	DataRegexp string   `json:"data_regexp"`
+	Condition  string   `json:"condition"`
+
+	// CrashClass marks a rule as a known ICE signature scoped to one
+	// specific crash block in Fuzz, rather than a known pre-crash
+	// disagreement checked at the top of Fuzz over raw, unconfirmed
+	// errors. Empty (the common case) means the rule applies at the
+	// top-level suppress(data, errs, "") call. One of crashClassGC,
+	// crashClassGccgo or crashClassGccgoAsan means it only applies from
+	// that specific crash block's suppress call, once gcCrash/gccgoCrash/
+	// asanCrash has already matched the relevant backend's error. This is
+	// split by block, not by a single crash/no-crash bool, because
+	// gccgoCrash and asanCrash both key off backend "gccgo" and would
+	// otherwise leak each other's ICE-signature rules into the wrong
+	// block — e.g. issue11536 (a gccgoCrash-only signature) must not be
+	// reachable from the asanCrash call, and vice versa for issue11577.
+	CrashClass string `json:"crash_class"`
+
+	errRe  *regexp.Regexp
+	dataRe *regexp.Regexp
+	hits   uint64
+}
+
+var rules []*Rule
+
+func init() {
+	if path := os.Getenv(rulesEnvVar); path != "" {
+		// An explicit override path that fails to load (unreadable file,
+		// invalid JSON or an invalid regexp) falls back to the embedded
+		// default rules below.
+		if err := loadRulesFile(path); err == nil {
+			return
+		}
+	}
+	if err := loadRules(defaultRules); err != nil {
+		panic("gotypes: embedded rules.json is invalid: " + err.Error())
+	}
+}
+
+func loadRulesFile(path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	return loadRules(data)
+}
+
+func loadRules(data []byte) error {
+	var loaded []*Rule
+	if err := json.Unmarshal(data, &loaded); err != nil {
+		return err
+	}
+	for _, r := range loaded {
+		var err error
+		if r.ErrRegexp != "" {
+			if r.errRe, err = regexp.Compile(r.ErrRegexp); err != nil {
+				return err
+			}
+		}
+		if r.DataRegexp != "" {
+			if r.dataRe, err = regexp.Compile(r.DataRegexp); err != nil {
+				return err
+			}
+		}
+	}
+	rules = loaded
+	return nil
+}
+
+// suppress reports whether some loaded rule explains away the given
+// combination of data and backend errors, and bumps that rule's counter.
+// crashClass selects which slice of the registry is eligible: "" for the
+// top-level pre-crash check in Fuzz (known-disagreement rules only), or
+// one of crashClassGC/crashClassGccgo/crashClassGccgoAsan for the matching
+// crash block once its crash signature has already matched (that block's
+// known-ICE-signature rules only). A rule never fires from a call it
+// isn't scoped for.
+func suppress(data []byte, errs map[string]error, crashClass string) bool {
+	for _, r := range rules {
+		if r.CrashClass != crashClass {
+			continue
+		}
+		if r.matches(data, errs) {
+			atomic.AddUint64(&r.hits, 1)
+			return true
+		}
+	}
+	return false
+}
+
+func (r *Rule) matches(data []byte, errs map[string]error) bool {
+	if r.Condition != "" && !evalCondition(r.Condition, errs) {
+		return false
+	}
+	if r.dataRe != nil && !r.dataRe.Match(data) {
+		return false
+	}
+	if r.ErrSubstr == "" && r.errRe == nil {
+		// Condition/data-only rule (e.g. the issue11528 XOR case).
+		return true
+	}
+	keys := r.Backends
+	if len(r.Triples) > 0 {
+		keys = r.Triples
+	}
+	for _, backend := range keys {
+		err := errs[backend]
+		if err == nil {
+			continue
+		}
+		if r.ErrSubstr != "" && strings.Contains(err.Error(), r.ErrSubstr) {
+			return true
+		}
+		if r.errRe != nil && r.errRe.MatchString(err.Error()) {
+			return true
+		}
+	}
+	return false
+}
+
+// evalCondition evaluates clauses joined by "&&", each either "x==nil",
+// "x!=nil" or "disagree(x,y)" (exactly one of x, y is nil), where x and y
+// are keys into errs ("go", "gc", "gccgo").
+func evalCondition(cond string, errs map[string]error) bool {
+	for _, clause := range strings.Split(cond, "&&") {
+		clause = strings.TrimSpace(clause)
+		switch {
+		case strings.HasPrefix(clause, "disagree("):
+			inner := strings.TrimSuffix(strings.TrimPrefix(clause, "disagree("), ")")
+			parts := strings.SplitN(inner, ",", 2)
+			if len(parts) != 2 {
+				return false
+			}
+			a := errs[strings.TrimSpace(parts[0])] == nil
+			b := errs[strings.TrimSpace(parts[1])] == nil
+			if a == b {
+				return false
+			}
+		case strings.Contains(clause, "!="):
+			name := strings.TrimSpace(strings.SplitN(clause, "!=", 2)[0])
+			if errs[name] == nil {
+				return false
+			}
+		case strings.Contains(clause, "=="):
+			name := strings.TrimSpace(strings.SplitN(clause, "==", 2)[0])
+			if errs[name] != nil {
+				return false
+			}
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+// RuleStats returns how many times each named rule has fired so far,
+// omitting rules that never matched. Handy for spotting known-issue
+// entries whose upstream bug has since been fixed and can be retired.
+func RuleStats() map[string]uint64 {
+	stats := make(map[string]uint64, len(rules))
+	for _, r := range rules {
+		if n := atomic.LoadUint64(&r.hits); n > 0 {
+			stats[r.Name] = n
+		}
+	}
+	return stats
+}
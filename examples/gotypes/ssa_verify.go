@@ -0,0 +1,150 @@
+package gotypes
+
+import (
+	"fmt"
+	"go/ast"
+	"go/token"
+	"go/types"
+	"io/ioutil"
+
+	"golang.org/x/tools/go/ssa"
+	"golang.org/x/tools/go/ssa/ssautil"
+)
+
+// buildSSA builds the single-file package pkg under the given builder mode
+// and returns the resulting *ssa.Package. gotypes calls it once with
+// ssa.BuildSerially and once without it so the two builds can be diffed
+// against each other; verifySSARoundTrip calls it once more.
+func buildSSA(fset *token.FileSet, f *ast.File, pkg *types.Package, info *types.Info, mode ssa.BuilderMode) *ssa.Package {
+	prog := ssa.NewProgram(fset, mode|ssa.SanityCheckFunctions|ssa.GlobalDebug)
+	// pkg now resolves real imports (conf.Check runs with an Importer), so
+	// the program needs an ssa.Package for each of them too, without
+	// source, before Build() can walk pkg's init/function bodies.
+	for _, imp := range importClosure(pkg) {
+		prog.CreatePackage(imp, nil, nil, true)
+	}
+	ssaPkg := prog.CreatePackage(pkg, []*ast.File{f}, info, false)
+	prog.Build()
+	return ssaPkg
+}
+
+// importClosure returns every package transitively imported by pkg, each
+// exactly once.
+func importClosure(pkg *types.Package) []*types.Package {
+	seen := make(map[*types.Package]bool)
+	var closure []*types.Package
+	var visit func(*types.Package)
+	visit = func(p *types.Package) {
+		for _, imp := range p.Imports() {
+			if seen[imp] {
+				continue
+			}
+			seen[imp] = true
+			closure = append(closure, imp)
+			visit(imp)
+		}
+	}
+	visit(pkg)
+	return closure
+}
+
+// funcSnapshot is the part of a built *ssa.Function that a deterministic
+// builder must reproduce identically between runs: its signature, block
+// count and the sequence of instruction opcodes in program order.
+type funcSnapshot struct {
+	sig        string
+	blockCount int
+	opcodes    []string
+}
+
+func snapshotFunc(fn *ssa.Function) funcSnapshot {
+	var opcodes []string
+	for _, b := range fn.Blocks {
+		for _, instr := range b.Instrs {
+			opcodes = append(opcodes, fmt.Sprintf("%T", instr))
+		}
+	}
+	return funcSnapshot{
+		sig:        fn.Signature.String(),
+		blockCount: len(fn.Blocks),
+		opcodes:    opcodes,
+	}
+}
+
+func snapshotPackage(pkg *ssa.Package) map[string]funcSnapshot {
+	snap := make(map[string]funcSnapshot)
+	for _, mem := range pkg.Members {
+		if fn, ok := mem.(*ssa.Function); ok {
+			snap[fn.Name()] = snapshotFunc(fn)
+		}
+	}
+	return snap
+}
+
+// diffSSA builds of the same package are expected to be byte-for-byte
+// equivalent regardless of whether BuildSerially was set, so any
+// difference here is a bug in the SSA builder itself, not in the fuzzed
+// program. Returns a human-readable description of the first difference
+// found, or "" if the two builds agree.
+func diffSSA(serial, parallel *ssa.Package) string {
+	a, b := snapshotPackage(serial), snapshotPackage(parallel)
+	if len(a) != len(b) {
+		return fmt.Sprintf("function count differs: %d (serial) vs %d (parallel)", len(a), len(b))
+	}
+	for name, fa := range a {
+		fb, ok := b[name]
+		if !ok {
+			return fmt.Sprintf("function %s missing from parallel build", name)
+		}
+		if fa.sig != fb.sig {
+			return fmt.Sprintf("function %s signature differs: %q vs %q", name, fa.sig, fb.sig)
+		}
+		if fa.blockCount != fb.blockCount {
+			return fmt.Sprintf("function %s block count differs: %d vs %d", name, fa.blockCount, fb.blockCount)
+		}
+		if !equalOpcodes(fa.opcodes, fb.opcodes) {
+			return fmt.Sprintf("function %s instruction opcodes differ", name)
+		}
+	}
+	return ""
+}
+
+func equalOpcodes(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// verifySSARoundTrip writes every function reachable from pkg to a buffer
+// (ssa.Function.WriteTo, the printer half of the SSA text format, run here
+// purely for its side effects) and then rebuilds the same package from
+// scratch under a fresh *ssa.Program with the SanityCheckFunctions builder
+// mode bit set. ssa.SanityCheckFunctions is a BuilderMode bitmask, not a
+// standalone checker function, so "re-running" it means asking the
+// builder to sanity-check itself again; the builder panics internally on
+// a failed check, which we recover here and turn into a plain error. A
+// build that fails this second pass after WriteTo already ran indicates
+// WriteTo mutated shared state it shouldn't have, distinct from a bug in
+// the fuzzed program.
+func verifySSARoundTrip(fset *token.FileSet, f *ast.File, pkg *types.Package, info *types.Info, built *ssa.Package) (err error) {
+	all := ssautil.AllFunctions(built.Prog)
+	for fn := range all {
+		if _, werr := fn.WriteTo(ioutil.Discard); werr != nil {
+			return fmt.Errorf("%s: WriteTo failed: %v", fn, werr)
+		}
+	}
+
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("sanity check failed after WriteTo round-trip: %v", r)
+		}
+	}()
+	buildSSA(fset, f, pkg, info, ssa.SanityCheckFunctions)
+	return nil
+}